@@ -0,0 +1,92 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gardener/logging/pkg/config"
+
+	"github.com/prometheus/common/model"
+)
+
+type stubLokiClient struct{ applyConfigCalled bool }
+
+func (c *stubLokiClient) Handle(_ model.LabelSet, _ time.Time, _ string) error { return nil }
+func (c *stubLokiClient) Stop()                                               {}
+func (c *stubLokiClient) StopWait()                                           {}
+func (c *stubLokiClient) StopNow()                                            {}
+func (c *stubLokiClient) ApplyConfig(_ *config.Config) error {
+	c.applyConfigCalled = true
+	return nil
+}
+
+func TestDqueClientApplyConfigRejectsBufferTypeChange(t *testing.T) {
+	stub := &stubLokiClient{}
+	dc := &dqueClient{lokiclient: stub, bufferDir: "/buf"}
+
+	err := dc.ApplyConfig(&config.Config{ClientConfig: config.ClientConfig{
+		BufferConfig: config.BufferConfig{BufferType: walBufferType, BufferDir: "/buf"},
+	}})
+	if err == nil {
+		t.Fatal("expected an error when buffer type changes from dque to wal")
+	}
+	if stub.applyConfigCalled {
+		t.Fatal("wrapped client's ApplyConfig must not run when the new config is rejected")
+	}
+}
+
+func TestDqueClientApplyConfigRejectsBufferDirChange(t *testing.T) {
+	stub := &stubLokiClient{}
+	dc := &dqueClient{lokiclient: stub, bufferDir: "/buf"}
+
+	err := dc.ApplyConfig(&config.Config{ClientConfig: config.ClientConfig{
+		BufferConfig: config.BufferConfig{BufferType: dqueBufferType, BufferDir: "/other"},
+	}})
+	if err == nil {
+		t.Fatal("expected an error when buffer dir changes")
+	}
+}
+
+func TestWALClientApplyConfigRejectsBufferTypeChange(t *testing.T) {
+	stub := &stubLokiClient{}
+	wc := &walClient{lokiclient: stub, bufferDir: "/buf"}
+
+	err := wc.ApplyConfig(&config.Config{ClientConfig: config.ClientConfig{
+		BufferConfig: config.BufferConfig{BufferType: dqueBufferType, BufferDir: "/buf"},
+	}})
+	if err == nil {
+		t.Fatal("expected an error when buffer type changes from wal to dque")
+	}
+	if stub.applyConfigCalled {
+		t.Fatal("wrapped client's ApplyConfig must not run when the new config is rejected")
+	}
+}
+
+func TestWALClientApplyConfigDelegatesWhenCompatible(t *testing.T) {
+	stub := &stubLokiClient{}
+	wc := &walClient{lokiclient: stub, bufferDir: "/buf"}
+
+	err := wc.ApplyConfig(&config.Config{ClientConfig: config.ClientConfig{
+		BufferConfig: config.BufferConfig{BufferType: walBufferType, BufferDir: "/buf"},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyConfig: %v", err)
+	}
+	if !stub.applyConfigCalled {
+		t.Fatal("expected ApplyConfig to be delegated to the wrapped client")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"fmt"
+
+	"github.com/gardener/logging/pkg/config"
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/loki/pkg/promtail/client"
+)
+
+const (
+	dqueBufferType = "dque"
+	walBufferType  = "wal"
+)
+
+// NewLokiClientFunc creates the types.LokiClient a buffer ultimately flushes
+// entries to.
+type NewLokiClientFunc = func(cfg client.Config, logger log.Logger) (types.LokiClient, error)
+
+// NewBuffer returns a types.LokiClient which buffers entries on disk before
+// forwarding them to the client created by newClient, according to
+// cfg.ClientConfig.BufferConfig.
+func NewBuffer(cfg *config.Config, logger log.Logger, newClient NewLokiClientFunc) (types.LokiClient, error) {
+	switch cfg.ClientConfig.BufferConfig.BufferType {
+	case "", dqueBufferType:
+		return newDqueClient(cfg, logger, newClient)
+	case walBufferType:
+		return newWALClient(cfg, logger, newClient)
+	default:
+		return nil, fmt.Errorf("failed to parse BufferType %s", cfg.ClientConfig.BufferConfig.BufferType)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gardener/logging/pkg/config"
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/joncrlsn/dque"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	dqueSegmentSize = 500
+
+	// dqueRetryDelay is used to space out retries of a failed entry when the
+	// error it got back doesn't carry its own retry hint.
+	dqueRetryDelay = 1 * time.Second
+)
+
+// dqueEntry is the on-disk representation of a buffered log line.
+type dqueEntry struct {
+	Labels    model.LabelSet
+	Timestamp time.Time
+	Line      string
+}
+
+func dqueEntryBuilder() interface{} {
+	return &dqueEntry{}
+}
+
+// dqueClient persists incoming entries to an on-disk queue and forwards them
+// to the wrapped client from a background goroutine, so that logs survive a
+// restart of the wrapped client (but not a crash, since dque only fsyncs
+// periodically).
+type dqueClient struct {
+	logger     log.Logger
+	queue      *dque.DQue
+	lokiclient types.LokiClient
+	bufferDir  string
+
+	done chan struct{}
+}
+
+func newDqueClient(cfg *config.Config, logger log.Logger, newClient NewLokiClientFunc) (types.LokiClient, error) {
+	c, err := newClient(cfg.ClientConfig.GrafanaLokiConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := dque.NewOrOpen(cfg.ClientConfig.GrafanaLokiConfig.URL.Hostname(), cfg.ClientConfig.BufferConfig.BufferDir, dqueSegmentSize, dqueEntryBuilder)
+	if err != nil {
+		return nil, err
+	}
+
+	dc := &dqueClient{
+		logger:     logger,
+		queue:      q,
+		lokiclient: c,
+		bufferDir:  cfg.ClientConfig.BufferConfig.BufferDir,
+		done:       make(chan struct{}),
+	}
+
+	go dc.run()
+
+	return dc, nil
+}
+
+func (c *dqueClient) Handle(ls model.LabelSet, t time.Time, s string) error {
+	return c.queue.Enqueue(&dqueEntry{Labels: ls, Timestamp: t, Line: s})
+}
+
+func (c *dqueClient) run() {
+	defer close(c.done)
+	for {
+		item, err := c.queue.DequeueBlock()
+		if err != nil {
+			if err == dque.ErrQueueClosed {
+				return
+			}
+			level.Error(c.logger).Log("msg", "failed to dequeue buffered entry", "err", err)
+			continue
+		}
+
+		e, ok := item.(*dqueEntry)
+		if !ok {
+			level.Error(c.logger).Log("msg", "dequeued entry of unexpected type")
+			continue
+		}
+
+		c.forward(e)
+	}
+}
+
+// forward pushes e to the wrapped client. On a types.RetryableError (e.g. a
+// tenant backing off per the defaultBackoffController) - an expected,
+// transient condition, not a permanent one - e is scheduled to be
+// re-enqueued once the backoff elapses, instead of retried in place: the
+// dque is a single on-disk FIFO shared by every tenant, so blocking this,
+// its only consumer goroutine, on one backing-off tenant would hold up
+// every other tenant's entries sitting behind it in the queue. Any other
+// error is logged and the entry is dropped, matching prior behavior.
+func (c *dqueClient) forward(e *dqueEntry) {
+	err := c.lokiclient.Handle(e.Labels, e.Timestamp, e.Line)
+	if err == nil {
+		return
+	}
+
+	var retryable types.RetryableError
+	if !errors.As(err, &retryable) {
+		level.Error(c.logger).Log("msg", "failed to forward buffered entry", "err", err)
+		return
+	}
+
+	delay := retryable.Delay()
+	if delay <= 0 {
+		delay = dqueRetryDelay
+	}
+	level.Warn(c.logger).Log("msg", "buffered entry is rate-limited, will retry", "err", err, "retry_in", delay)
+
+	time.AfterFunc(delay, func() {
+		if err := c.queue.Enqueue(e); err != nil {
+			level.Error(c.logger).Log("msg", "failed to re-enqueue rate-limited entry", "err", err)
+		}
+	})
+}
+
+// Stop the client.
+func (c *dqueClient) Stop() {
+	_ = c.queue.Close()
+	<-c.done
+	c.lokiclient.Stop()
+}
+
+// StopWait stops forwarding from the queue and then stops the wrapped client
+// with StopWait. Entries still queued on disk are not forwarded; they stay
+// in the queue for the next start.
+func (c *dqueClient) StopWait() {
+	_ = c.queue.Close()
+	<-c.done
+	c.lokiclient.StopWait()
+}
+
+// StopNow aborts the client immediately, without waiting for entries still
+// queued on disk to be forwarded.
+func (c *dqueClient) StopNow() {
+	_ = c.queue.Close()
+	<-c.done
+	c.lokiclient.StopNow()
+}
+
+// ApplyConfig rejects any change to the buffer type or directory, since
+// swapping either out from under the running dque would require recreating
+// the queue, then passes the new config down to the wrapped client.
+func (c *dqueClient) ApplyConfig(newCfg *config.Config) error {
+	newBufferType := newCfg.ClientConfig.BufferConfig.BufferType
+	if newBufferType != "" && newBufferType != dqueBufferType {
+		return fmt.Errorf("cannot apply config: buffer type changed from %q to %q, client must be recreated", dqueBufferType, newBufferType)
+	}
+	if newCfg.ClientConfig.BufferConfig.BufferDir != c.bufferDir {
+		return fmt.Errorf("cannot apply config: buffer directory changed, client must be recreated")
+	}
+
+	return c.lokiclient.ApplyConfig(newCfg)
+}
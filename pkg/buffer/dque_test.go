@@ -0,0 +1,112 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/joncrlsn/dque"
+	"github.com/prometheus/common/model"
+)
+
+type retryableErr struct{ delay time.Duration }
+
+func (e *retryableErr) Error() string        { return "rate-limited" }
+func (e *retryableErr) Delay() time.Duration { return e.delay }
+
+// flakyClient embeds stubLokiClient and fails Handle with failErr for the
+// first failTimes calls before succeeding.
+type flakyClient struct {
+	stubLokiClient
+	calls     int
+	failTimes int
+	failErr   error
+}
+
+func (c *flakyClient) Handle(_ model.LabelSet, _ time.Time, _ string) error {
+	c.calls++
+	if c.calls <= c.failTimes {
+		return c.failErr
+	}
+	return nil
+}
+
+// dequeueWithTimeout is a test helper around DequeueBlock that fails instead
+// of hanging forever if nothing is re-enqueued in time.
+func dequeueWithTimeout(t *testing.T, q *dque.DQue, timeout time.Duration) interface{} {
+	t.Helper()
+
+	result := make(chan interface{}, 1)
+	go func() {
+		item, err := q.DequeueBlock()
+		if err != nil {
+			return
+		}
+		result <- item
+	}()
+
+	select {
+	case item := <-result:
+		return item
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for entry to be re-enqueued")
+		return nil
+	}
+}
+
+func TestDqueClientForwardReenqueuesOnRetryableErrorWithoutBlocking(t *testing.T) {
+	wrapped := &flakyClient{failTimes: 1, failErr: &retryableErr{delay: 10 * time.Millisecond}}
+	q, err := dque.NewOrOpen("forward-retry", t.TempDir(), dqueSegmentSize, dqueEntryBuilder)
+	if err != nil {
+		t.Fatalf("dque.NewOrOpen: %v", err)
+	}
+	defer q.Close() //nolint:errcheck
+
+	dc := &dqueClient{queue: q, lokiclient: wrapped, logger: log.NewNopLogger()}
+
+	start := time.Now()
+	dc.forward(&dqueEntry{Line: "hello"})
+	if elapsed := time.Since(start); elapsed > 5*time.Millisecond {
+		t.Fatalf("forward blocked for %s instead of returning immediately on a retryable error", elapsed)
+	}
+	if wrapped.calls != 1 {
+		t.Fatalf("got %d Handle calls, want 1 before the entry is re-enqueued", wrapped.calls)
+	}
+
+	item := dequeueWithTimeout(t, q, time.Second)
+	e, ok := item.(*dqueEntry)
+	if !ok || e.Line != "hello" {
+		t.Fatalf("got re-enqueued item %+v, want the original entry", item)
+	}
+
+	dc.forward(e)
+	if wrapped.calls != 2 {
+		t.Fatalf("got %d Handle calls, want 2 (1 failure + 1 success) after re-enqueue", wrapped.calls)
+	}
+}
+
+func TestDqueClientForwardDropsOnPermanentError(t *testing.T) {
+	wrapped := &flakyClient{failTimes: 100, failErr: fmt.Errorf("permanent failure")}
+	dc := &dqueClient{lokiclient: wrapped, logger: log.NewNopLogger()}
+
+	dc.forward(&dqueEntry{Line: "hello"})
+
+	if wrapped.calls != 1 {
+		t.Fatalf("got %d Handle calls, want 1 (no retry on a non-retryable error)", wrapped.calls)
+	}
+}
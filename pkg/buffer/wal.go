@@ -0,0 +1,328 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gardener/logging/pkg/config"
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// defaultWALSegmentSize is the size at which the WAL rotates to a new
+	// segment.
+	defaultWALSegmentSize = 256 * 1024 * 1024
+	walSegmentSuffix      = ".wal"
+	frameHeaderSize       = 8 // 4 bytes payload length + 4 bytes CRC32
+)
+
+var errChecksumMismatch = errors.New("wal: checksum mismatch")
+
+// walRecord is the decoded form of a single WAL entry: the label set plus
+// the logproto.Entry Promtail's writer-side WAL also persists.
+type walRecord struct {
+	Labels model.LabelSet
+	Entry  logproto.Entry
+}
+
+func encodeRecord(r walRecord) ([]byte, error) {
+	labelBytes, err := json.Marshal(r.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("wal: failed to marshal labels: %w", err)
+	}
+	entryBytes, err := r.Entry.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("wal: failed to marshal entry: %w", err)
+	}
+
+	payload := make([]byte, 4+len(labelBytes)+len(entryBytes))
+	binary.BigEndian.PutUint32(payload[:4], uint32(len(labelBytes)))
+	copy(payload[4:], labelBytes)
+	copy(payload[4+len(labelBytes):], entryBytes)
+	return payload, nil
+}
+
+func decodeRecord(payload []byte) (walRecord, error) {
+	if len(payload) < 4 {
+		return walRecord{}, errors.New("wal: record too short")
+	}
+	labelLen := int(binary.BigEndian.Uint32(payload[:4]))
+	if 4+labelLen > len(payload) {
+		return walRecord{}, errors.New("wal: corrupt record")
+	}
+
+	var ls model.LabelSet
+	if err := json.Unmarshal(payload[4:4+labelLen], &ls); err != nil {
+		return walRecord{}, fmt.Errorf("wal: failed to unmarshal labels: %w", err)
+	}
+
+	var e logproto.Entry
+	if err := e.Unmarshal(payload[4+labelLen:]); err != nil {
+		return walRecord{}, fmt.Errorf("wal: failed to unmarshal entry: %w", err)
+	}
+
+	return walRecord{Labels: ls, Entry: e}, nil
+}
+
+// writeFrame length-prefixes and CRC32-checksums payload before writing it
+// to w, returning the number of bytes written.
+func writeFrame(w io.Writer, payload []byte) (int, error) {
+	var hdr [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(hdr[4:], crc32.ChecksumIEEE(payload))
+
+	n, err := w.Write(append(hdr[:], payload...))
+	return n, err
+}
+
+// readFrame reads a single length-prefixed, CRC32-checksummed frame from r.
+// It returns io.EOF/io.ErrUnexpectedEOF when the frame is missing or
+// truncated (e.g. a partial write left by a crash), and errChecksumMismatch
+// when the frame is complete but its checksum doesn't match, so the caller
+// can skip it and keep reading. n is the number of bytes the frame occupies
+// on disk, valid when err is nil or errChecksumMismatch.
+func readFrame(r io.Reader) (payload []byte, n int, err error) {
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(hdr[:4])
+	crc := binary.BigEndian.Uint32(hdr[4:])
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	n = frameHeaderSize + int(length)
+	if crc32.ChecksumIEEE(payload) != crc {
+		return nil, n, errChecksumMismatch
+	}
+	return payload, n, nil
+}
+
+func walSegmentPath(dir string, id int) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", id, walSegmentSuffix))
+}
+
+// listWALSegments returns the sorted segment IDs present in dir.
+func listWALSegments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, walSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(name, walSegmentSuffix))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// wal is the write side of the WAL-backed buffer: a segmented, append-only
+// log of length-prefixed, checksummed records.
+type wal struct {
+	mu sync.Mutex
+
+	dir         string
+	segmentSize int64
+
+	cur     *os.File
+	curID   int
+	curSize int64
+}
+
+func openWAL(dir string, segmentSize int64) (*wal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("wal: failed to create buffer dir: %w", err)
+	}
+
+	ids, err := listWALSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	id := 0
+	if len(ids) > 0 {
+		id = ids[len(ids)-1]
+	}
+
+	f, err := os.OpenFile(walSegmentPath(dir, id), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("wal: failed to open segment %d: %w", id, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &wal{
+		dir:         dir,
+		segmentSize: segmentSize,
+		cur:         f,
+		curID:       id,
+		curSize:     info.Size(),
+	}, nil
+}
+
+// Append writes a new record to the active segment, rotating to a new
+// segment once the configured size is exceeded.
+func (w *wal) Append(ls model.LabelSet, t time.Time, s string) error {
+	payload, err := encodeRecord(walRecord{Labels: ls, Entry: logproto.Entry{Timestamp: t, Line: s}})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := writeFrame(w.cur, payload)
+	if err != nil {
+		return fmt.Errorf("wal: failed to append record: %w", err)
+	}
+	w.curSize += int64(n)
+
+	if w.curSize >= w.segmentSize {
+		return w.rotate()
+	}
+	return nil
+}
+
+func (w *wal) rotate() error {
+	if err := w.cur.Close(); err != nil {
+		return fmt.Errorf("wal: failed to close segment %d: %w", w.curID, err)
+	}
+
+	w.curID++
+	f, err := os.OpenFile(walSegmentPath(w.dir, w.curID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("wal: failed to open segment %d: %w", w.curID, err)
+	}
+
+	w.cur = f
+	w.curSize = 0
+	return nil
+}
+
+func (w *wal) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cur.Close()
+}
+
+// walClient is the types.LokiClient exposed by the WAL-backed buffer: Handle
+// appends to the WAL and returns immediately, while a background
+// walReader tails the segments and forwards entries to the wrapped client.
+type walClient struct {
+	w          *wal
+	reader     *walReader
+	lokiclient types.LokiClient
+	bufferDir  string
+}
+
+func newWALClient(cfg *config.Config, logger log.Logger, newClient NewLokiClientFunc) (types.LokiClient, error) {
+	c, err := newClient(cfg.ClientConfig.GrafanaLokiConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	segmentSize := cfg.ClientConfig.BufferConfig.WALSegmentSize
+	if segmentSize <= 0 {
+		segmentSize = defaultWALSegmentSize
+	}
+
+	w, err := openWAL(cfg.ClientConfig.BufferConfig.BufferDir, segmentSize)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := newWALReader(cfg.ClientConfig.BufferConfig.BufferDir, c, logger)
+	go reader.run()
+
+	return &walClient{w: w, reader: reader, lokiclient: c, bufferDir: cfg.ClientConfig.BufferConfig.BufferDir}, nil
+}
+
+func (c *walClient) Handle(ls model.LabelSet, t time.Time, s string) error {
+	return c.w.Append(ls, t, s)
+}
+
+// Stop the client, first letting the reader catch up with everything
+// written to the WAL so far.
+func (c *walClient) Stop() {
+	c.reader.stop(true)
+	_ = c.w.Close()
+	c.lokiclient.Stop()
+}
+
+// StopWait stops the client waiting all saved logs to be sent.
+func (c *walClient) StopWait() {
+	c.reader.stop(true)
+	_ = c.w.Close()
+	c.lokiclient.StopWait()
+}
+
+// StopNow aborts the client immediately, leaving whatever the reader hasn't
+// yet forwarded on disk to be replayed on the next start.
+func (c *walClient) StopNow() {
+	c.reader.stop(false)
+	_ = c.w.Close()
+	c.lokiclient.StopNow()
+}
+
+// ApplyConfig rejects any change to the buffer type or directory, since
+// swapping either out from under the running WAL would require recreating
+// it, then passes the new config down to the wrapped client.
+func (c *walClient) ApplyConfig(newCfg *config.Config) error {
+	if newCfg.ClientConfig.BufferConfig.BufferType != walBufferType {
+		return fmt.Errorf("cannot apply config: buffer type changed from %q to %q, client must be recreated", walBufferType, newCfg.ClientConfig.BufferConfig.BufferType)
+	}
+	if newCfg.ClientConfig.BufferConfig.BufferDir != c.bufferDir {
+		return fmt.Errorf("cannot apply config: buffer directory changed, client must be recreated")
+	}
+
+	return c.lokiclient.ApplyConfig(newCfg)
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	checkpointFileName = "checkpoint"
+	walReaderPollWait  = time.Second
+)
+
+// loadCheckpoint returns the (segment, offset) pair the reader last
+// acknowledged, or (0, 0) if no checkpoint exists yet.
+func loadCheckpoint(dir string) (int, int64) {
+	b, err := os.ReadFile(filepath.Join(dir, checkpointFileName))
+	if err != nil {
+		return 0, 0
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(string(b)), " ", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+
+	segment, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0
+	}
+	offset, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0
+	}
+	return segment, offset
+}
+
+// saveCheckpoint atomically persists (segment, offset) as the last position
+// the reader has forwarded and had acknowledged by the wrapped client.
+func saveCheckpoint(dir string, segment int, offset int64) error {
+	tmp := filepath.Join(dir, checkpointFileName+".tmp")
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d", segment, offset)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, checkpointFileName))
+}
+
+// walReader tails the WAL segments in dir from the last checkpoint forward
+// and forwards each replayed record to the wrapped client, checkpointing
+// after every record the client actually acknowledges delivering, so that
+// segments before the checkpoint can be truncated and, on restart, no
+// acknowledged logs are replayed twice.
+type walReader struct {
+	dir        string
+	lokiclient types.LokiClient
+	logger     log.Logger
+
+	quit chan bool
+	done chan struct{}
+}
+
+// handle forwards a record to the wrapped client and reports whether it was
+// actually delivered. It prefers types.SyncHandler, which blocks for a real
+// delivery outcome; Handle alone isn't enough here, since
+// promtailClientWithForwardedLogsMetricCounter's Handle only queues the
+// entry for a later async flush and returns nil immediately, which would let
+// replayFrom checkpoint (and truncateBefore delete) a record before it has
+// actually reached Loki.
+func (r *walReader) handle(ls model.LabelSet, t time.Time, s string) error {
+	if sh, ok := r.lokiclient.(types.SyncHandler); ok {
+		return sh.HandleSync(ls, t, s)
+	}
+	return r.lokiclient.Handle(ls, t, s)
+}
+
+func newWALReader(dir string, lokiclient types.LokiClient, logger log.Logger) *walReader {
+	return &walReader{
+		dir:        dir,
+		lokiclient: lokiclient,
+		logger:     logger,
+		quit:       make(chan bool),
+		done:       make(chan struct{}),
+	}
+}
+
+func (r *walReader) run() {
+	defer close(r.done)
+
+	segment, offset := loadCheckpoint(r.dir)
+	ticker := time.NewTicker(walReaderPollWait)
+	defer ticker.Stop()
+
+	for {
+		segment, offset = r.replayFrom(segment, offset)
+		r.truncateBefore(segment)
+
+		select {
+		case <-ticker.C:
+		case flush := <-r.quit:
+			if flush {
+				segment, offset = r.replayFrom(segment, offset)
+				r.truncateBefore(segment)
+			}
+			return
+		}
+	}
+}
+
+// stop asks the reader to exit, optionally doing one last replay pass first
+// so everything already on disk gets forwarded before Stop/StopWait return.
+func (r *walReader) stop(flush bool) {
+	r.quit <- flush
+	<-r.done
+}
+
+// replayFrom forwards every record from (segment, offset) to the end of the
+// WAL and returns the position the reader has reached. It stops short of a
+// push that fails so the same record is retried on the next pass instead of
+// being skipped.
+func (r *walReader) replayFrom(segment int, offset int64) (int, int64) {
+	for {
+		f, err := os.Open(walSegmentPath(r.dir, segment))
+		if os.IsNotExist(err) {
+			return segment, offset
+		}
+		if err != nil {
+			level.Error(r.logger).Log("msg", "wal: failed to open segment", "segment", segment, "err", err)
+			return segment, offset
+		}
+
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			level.Error(r.logger).Log("msg", "wal: failed to seek segment", "segment", segment, "err", err)
+			_ = f.Close()
+			return segment, offset
+		}
+
+		for {
+			payload, n, err := readFrame(f)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// No more complete records in this segment yet (or a
+				// partial write left by a crash) - stop here and retry
+				// on the next pass.
+				break
+			}
+			if err == errChecksumMismatch {
+				level.Warn(r.logger).Log("msg", "wal: dropping corrupt record", "segment", segment, "offset", offset)
+				offset += int64(n)
+				continue
+			}
+			if err != nil {
+				level.Error(r.logger).Log("msg", "wal: failed to read record", "segment", segment, "err", err)
+				break
+			}
+
+			rec, err := decodeRecord(payload)
+			if err != nil {
+				level.Warn(r.logger).Log("msg", "wal: dropping unreadable record", "segment", segment, "offset", offset, "err", err)
+				offset += int64(n)
+				continue
+			}
+
+			if err := r.handle(rec.Labels, rec.Entry.Timestamp, rec.Entry.Line); err != nil {
+				level.Error(r.logger).Log("msg", "wal: failed to forward record, will retry", "err", err)
+				_ = f.Close()
+				return segment, offset
+			}
+
+			offset += int64(n)
+			if err := saveCheckpoint(r.dir, segment, offset); err != nil {
+				level.Error(r.logger).Log("msg", "wal: failed to save checkpoint", "err", err)
+			}
+		}
+		_ = f.Close()
+
+		if _, err := os.Stat(walSegmentPath(r.dir, segment+1)); err != nil {
+			return segment, offset
+		}
+		segment++
+		offset = 0
+	}
+}
+
+// truncateBefore removes every segment strictly older than segment, now
+// that the reader has fully acknowledged it.
+func (r *walReader) truncateBefore(segment int) {
+	ids, err := listWALSegments(r.dir)
+	if err != nil {
+		level.Error(r.logger).Log("msg", "wal: failed to list segments", "err", err)
+		return
+	}
+
+	for _, id := range ids {
+		if id >= segment {
+			continue
+		}
+		if err := os.Remove(walSegmentPath(r.dir, id)); err != nil {
+			level.Error(r.logger).Log("msg", "wal: failed to truncate segment", "segment", id, "err", err)
+		}
+	}
+}
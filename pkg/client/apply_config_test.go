@@ -0,0 +1,103 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gardener/logging/pkg/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// stubLokiClient records whether ApplyConfig was delegated to it.
+type stubLokiClient struct {
+	applyConfigCalled bool
+	applyConfigErr    error
+}
+
+func (c *stubLokiClient) Handle(_ model.LabelSet, _ time.Time, _ string) error { return nil }
+func (c *stubLokiClient) Stop()                                               {}
+func (c *stubLokiClient) StopWait()                                           {}
+func (c *stubLokiClient) StopNow()                                            {}
+func (c *stubLokiClient) ApplyConfig(_ *config.Config) error {
+	c.applyConfigCalled = true
+	return c.applyConfigErr
+}
+
+func TestRemoveTenantIdClientApplyConfigDelegates(t *testing.T) {
+	stub := &stubLokiClient{}
+	c := NewRemoveTenantIdClient(stub)
+
+	if err := c.ApplyConfig(&config.Config{}); err != nil {
+		t.Fatalf("ApplyConfig: %v", err)
+	}
+	if !stub.applyConfigCalled {
+		t.Fatal("expected ApplyConfig to be delegated to the wrapped client")
+	}
+}
+
+func TestMultiTenantClientApplyConfigDelegates(t *testing.T) {
+	stub := &stubLokiClient{}
+	c := NewMultiTenantClientWrapper(stub, false)
+
+	if err := c.ApplyConfig(&config.Config{}); err != nil {
+		t.Fatalf("ApplyConfig: %v", err)
+	}
+	if !stub.applyConfigCalled {
+		t.Fatal("expected ApplyConfig to be delegated to the wrapped client")
+	}
+}
+
+func TestSortedClientApplyConfigRejectsSortByTimestampChange(t *testing.T) {
+	sc := &sortedClient{numberOfBatchIDs: 1}
+
+	err := sc.ApplyConfig(&config.Config{ClientConfig: config.ClientConfig{
+		SortByTimestamp:  false,
+		NumberOfBatchIDs: 1,
+	}})
+	if err == nil {
+		t.Fatal("expected an error when SortByTimestamp changes")
+	}
+}
+
+func TestSortedClientApplyConfigRejectsNumberOfBatchIDsChange(t *testing.T) {
+	sc := &sortedClient{numberOfBatchIDs: 1}
+
+	err := sc.ApplyConfig(&config.Config{ClientConfig: config.ClientConfig{
+		SortByTimestamp:  true,
+		NumberOfBatchIDs: 2,
+	}})
+	if err == nil {
+		t.Fatal("expected an error when NumberOfBatchIDs changes")
+	}
+}
+
+func TestReRegistererReusesExistingRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r := reRegisterer{reg}
+
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_counter"})
+	if err := r.Register(c); err != nil {
+		t.Fatalf("first Register: %v", err)
+	}
+
+	dup := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_counter"})
+	if err := r.Register(dup); err != nil {
+		t.Fatalf("expected a colliding registration to be swallowed, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gardener/logging/pkg/metrics"
+)
+
+const (
+	minTenantBackoff = 1 * time.Second
+	maxTenantBackoff = 5 * time.Minute
+	// maxTenantBackoffShift caps the exponent used to grow the backoff so
+	// consecutiveFailures can't overflow the shift.
+	maxTenantBackoffShift = 10
+)
+
+// RateLimitedError is returned by Handle when the tenant carried by the
+// entry's label set is currently within a backoff window; the entry is
+// dropped rather than forwarded.
+type RateLimitedError struct {
+	Host       string
+	Tenant     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("tenant %q on %q is rate-limited, retry after %s", e.Tenant, e.Host, e.RetryAfter)
+}
+
+// Delay reports how much longer the tenant's backoff window is expected to
+// last, satisfying types.RetryableError so buffer wrappers know to retry the
+// entry rather than drop it.
+func (e *RateLimitedError) Delay() time.Duration {
+	return e.RetryAfter
+}
+
+type tenantKey struct {
+	host   string
+	tenant string
+}
+
+type tenantBackoffState struct {
+	until               time.Time
+	consecutiveFailures int
+}
+
+// tenantBackoffController tracks recent send outcomes per (host, tenant) so
+// that one tenant getting rate-limited on a shared Loki doesn't hold up logs
+// from every other tenant sharing the same client.
+type tenantBackoffController struct {
+	mu    sync.Mutex
+	state map[tenantKey]*tenantBackoffState
+}
+
+func newTenantBackoffController() *tenantBackoffController {
+	return &tenantBackoffController{state: make(map[tenantKey]*tenantBackoffState)}
+}
+
+// defaultBackoffController is shared by every promtailClientWithForwardedLogsMetricCounter
+// in the process, since the same Loki host is commonly shared by several tenants.
+var defaultBackoffController = newTenantBackoffController()
+
+// allow reports whether host/tenant may be sent right now, and if not, how
+// much longer the backoff window is expected to last.
+func (b *tenantBackoffController) allow(host, tenant string) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := tenantKey{host: host, tenant: tenant}
+	s, ok := b.state[key]
+	if !ok {
+		return 0, true
+	}
+
+	remaining := time.Until(s.until)
+	if remaining <= 0 {
+		return 0, true
+	}
+	return remaining, false
+}
+
+// observe records the outcome of a send covering host/tenant. statusCode 429
+// or >=500 (or 0, meaning the request never got a response) starts or
+// extends the backoff window; any other status clears it.
+func (b *tenantBackoffController) observe(host, tenant string, statusCode int, retryAfter time.Duration) {
+	retryable := statusCode == 429 || statusCode >= 500 || statusCode == 0
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := tenantKey{host: host, tenant: tenant}
+	if !retryable {
+		delete(b.state, key)
+		metrics.TenantBackoffSeconds.WithLabelValues(host, tenant).Set(0)
+		return
+	}
+
+	s, ok := b.state[key]
+	if !ok {
+		s = &tenantBackoffState{}
+		b.state[key] = s
+	}
+	s.consecutiveFailures++
+
+	backoff := retryAfter
+	if backoff <= 0 {
+		shift := s.consecutiveFailures - 1
+		if shift > maxTenantBackoffShift {
+			shift = maxTenantBackoffShift
+		}
+		backoff = minTenantBackoff << uint(shift) //nolint:gosec
+	}
+	if backoff > maxTenantBackoff {
+		backoff = maxTenantBackoff
+	}
+	s.until = time.Now().Add(backoff)
+
+	metrics.RetriedLogs.WithLabelValues(host, tenant).Inc()
+	metrics.TenantBackoffSeconds.WithLabelValues(host, tenant).Set(backoff.Seconds())
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTenantBackoffControllerAllowsByDefault(t *testing.T) {
+	b := newTenantBackoffController()
+
+	if _, allowed := b.allow("host", "tenant"); !allowed {
+		t.Fatal("expected a tenant with no recorded outcomes to be allowed")
+	}
+}
+
+func TestTenantBackoffControllerBlocksAfterRetryableStatus(t *testing.T) {
+	b := newTenantBackoffController()
+
+	b.observe("host", "tenant", 429, 0)
+
+	remaining, allowed := b.allow("host", "tenant")
+	if allowed {
+		t.Fatal("expected tenant to be in backoff after a 429")
+	}
+	if remaining <= 0 {
+		t.Fatalf("got remaining %s, want > 0", remaining)
+	}
+}
+
+func TestTenantBackoffControllerHonoursRetryAfter(t *testing.T) {
+	b := newTenantBackoffController()
+
+	b.observe("host", "tenant", 429, 5*time.Minute)
+
+	remaining, allowed := b.allow("host", "tenant")
+	if allowed {
+		t.Fatal("expected tenant to be in backoff")
+	}
+	if remaining > 5*time.Minute || remaining < 4*time.Minute {
+		t.Fatalf("got remaining %s, want close to 5m", remaining)
+	}
+}
+
+func TestTenantBackoffControllerClearsOnSuccess(t *testing.T) {
+	b := newTenantBackoffController()
+
+	b.observe("host", "tenant", 429, 0)
+	b.observe("host", "tenant", 200, 0)
+
+	if _, allowed := b.allow("host", "tenant"); !allowed {
+		t.Fatal("expected a successful response to clear backoff")
+	}
+}
+
+func TestTenantBackoffControllerIsolatesTenants(t *testing.T) {
+	b := newTenantBackoffController()
+
+	b.observe("host", "noisy-tenant", 429, time.Minute)
+
+	if _, allowed := b.allow("host", "quiet-tenant"); !allowed {
+		t.Fatal("expected a different tenant on the same host to remain unaffected")
+	}
+}
+
+func TestRateLimitedErrorImplementsRetryableError(t *testing.T) {
+	var err error = &RateLimitedError{Host: "host", Tenant: "tenant", RetryAfter: 30 * time.Second}
+
+	type retryable interface {
+		Delay() time.Duration
+	}
+	r, ok := err.(retryable)
+	if !ok {
+		t.Fatal("expected *RateLimitedError to implement Delay()")
+	}
+	if r.Delay() != 30*time.Second {
+		t.Fatalf("got Delay() %s, want 30s", r.Delay())
+	}
+}
@@ -15,6 +15,12 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gardener/logging/pkg/buffer"
@@ -23,10 +29,11 @@ import (
 	"github.com/gardener/logging/pkg/types"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
 	"github.com/grafana/loki/pkg/logproto"
-	"github.com/grafana/loki/pkg/promtail/api"
 	"github.com/grafana/loki/pkg/promtail/client"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 )
 
@@ -45,13 +52,16 @@ func NewClient(cfg *config.Config, logger log.Logger) (types.LokiClient, error)
 		err       error
 	)
 
-	if cfg.ClientConfig.SortByTimestamp {
+	switch {
+	case cfg.ClientConfig.SortByTimestamp && cfg.ClientConfig.Exporter == config.OTLPExporter:
+		return nil, fmt.Errorf("SortByTimestamp is not supported together with the %s exporter", config.OTLPExporter)
+	case cfg.ClientConfig.SortByTimestamp:
 		ncf = func(c client.Config, logger log.Logger) (types.LokiClient, error) {
 			return newSortedClient(c, cfg.ClientConfig.NumberOfBatchIDs, logger)
 		}
-	} else {
-		ncf = func(cfg client.Config, logger log.Logger) (types.LokiClient, error) {
-			c, err := NewPromtailClient(cfg, logger)
+	default:
+		ncf = func(_ client.Config, logger log.Logger) (types.LokiClient, error) {
+			c, err := newLeafClient(cfg, logger)
 			if err != nil {
 				return nil, err
 			}
@@ -68,38 +78,356 @@ func NewClient(cfg *config.Config, logger log.Logger) (types.LokiClient, error)
 	return newClient, err
 }
 
+// newLeafClient builds the client at the bottom of the wrapper chain,
+// selecting the OTLP exporter over the default Loki push protocol when
+// cfg.ClientConfig.Exporter asks for it.
+func newLeafClient(cfg *config.Config, logger log.Logger) (types.LokiClient, error) {
+	if cfg.ClientConfig.Exporter == config.OTLPExporter {
+		return NewOTLPClient(cfg.ClientConfig.OTLPConfig, logger)
+	}
+	return NewPromtailClient(cfg.ClientConfig.GrafanaLokiConfig, logger)
+}
+
+// pushEntry is a single log line queued for a Loki push request.
+type pushEntry struct {
+	ls model.LabelSet
+	t  time.Time
+	s  string
+}
+
+// promtailClientWithForwardedLogsMetricCounter pushes entries to Loki over
+// its HTTP API directly, batched per tenant, so that a 429 or 5xx response
+// can be attributed to the tenant that caused it and fed into
+// defaultBackoffController. While a tenant is backing off, Handle drops its
+// entries and returns a *RateLimitedError instead of queuing them.
 type promtailClientWithForwardedLogsMetricCounter struct {
-	lokiclient client.Client
+	mu         sync.RWMutex
+	cfg        client.Config
 	host       string
+	logger     log.Logger
+	httpClient *http.Client
+
+	// ctx is attached to every outgoing HTTP request; cancel aborts whatever
+	// send is currently in flight so StopNow can interrupt a flush already
+	// blocked against an unreachable Loki instead of waiting on it.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	pendingMu sync.Mutex
+	pending   map[string][]pushEntry
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+	// stop, once closed, asks run() to exit. flushOnStop records whether it
+	// should attempt one last flush first, and is only ever written before
+	// stop is closed, so run() can read it after <-stop without a lock.
+	stop        chan struct{}
+	flushOnStop bool
+	done        chan struct{}
 }
 
-// NewPromtailClient return promtail client which increments the ForwardedLogs counter on
-// successful call of the Handle function
+// NewPromtailClient returns a client which pushes entries to Loki's HTTP
+// push endpoint, incrementing the ForwardedLogs counter for every entry
+// successfully sent.
 func NewPromtailClient(cfg client.Config, logger log.Logger) (types.LokiClient, error) {
-	c, err := client.New(prometheus.DefaultRegisterer, cfg, logger)
-	if err != nil {
-		return nil, err
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := &promtailClientWithForwardedLogsMetricCounter{
+		cfg:         cfg,
+		host:        cfg.URL.Hostname(),
+		logger:      logger,
+		httpClient:  &http.Client{Timeout: cfg.Timeout},
+		ctx:         ctx,
+		cancel:      cancel,
+		pending:     make(map[string][]pushEntry),
+		stopped:     make(chan struct{}),
+		stop:        make(chan struct{}),
+		flushOnStop: true,
+		done:        make(chan struct{}),
 	}
-	return &promtailClientWithForwardedLogsMetricCounter{
-		lokiclient: c,
-		host:       cfg.URL.Hostname(),
-	}, nil
+
+	go c.run()
+	return c, nil
+}
+
+func tenantOf(ls model.LabelSet) string {
+	return string(ls[client.ReservedLabelTenantID])
 }
 
 func (c *promtailClientWithForwardedLogsMetricCounter) Handle(ls model.LabelSet, t time.Time, s string) error {
-	c.lokiclient.Chan() <- api.Entry{Labels: ls, Entry: logproto.Entry{Timestamp: t, Line: s}}
-	metrics.ForwardedLogs.WithLabelValues(c.host).Inc()
+	select {
+	case <-c.stopped:
+		return nil
+	default:
+	}
+
+	c.mu.RLock()
+	host := c.host
+	c.mu.RUnlock()
+
+	tenant := tenantOf(ls)
+	if retryAfter, allowed := defaultBackoffController.allow(host, tenant); !allowed {
+		metrics.DroppedLogs.WithLabelValues(host, tenant).Inc()
+		return &RateLimitedError{Host: host, Tenant: tenant, RetryAfter: retryAfter}
+	}
+
+	c.pendingMu.Lock()
+	c.pending[tenant] = append(c.pending[tenant], pushEntry{ls: ls, t: t, s: s})
+	c.pendingMu.Unlock()
 	return nil
 }
 
-// Stop the client.
+func (c *promtailClientWithForwardedLogsMetricCounter) run() {
+	defer close(c.done)
+
+	c.mu.RLock()
+	batchWait := c.cfg.BatchWait
+	c.mu.RUnlock()
+
+	waitCheckFrequency := batchWait / waitCheckFrequencyDelimiter
+	if waitCheckFrequency < minWaitCheckFrequency {
+		waitCheckFrequency = minWaitCheckFrequency
+	}
+
+	ticker := time.NewTicker(waitCheckFrequency)
+	defer ticker.Stop()
+
+	lastFlush := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.RLock()
+			maxWait := c.cfg.BatchWait
+			c.mu.RUnlock()
+			if time.Since(lastFlush) >= maxWait {
+				c.flush()
+				lastFlush = time.Now()
+			}
+		case <-c.stop:
+			if c.flushOnStop {
+				c.flush()
+			}
+			return
+		}
+	}
+}
+
+func (c *promtailClientWithForwardedLogsMetricCounter) flush() {
+	c.pendingMu.Lock()
+	batches := c.pending
+	c.pending = make(map[string][]pushEntry)
+	c.pendingMu.Unlock()
+
+	for tenant, entries := range batches {
+		if len(entries) == 0 {
+			continue
+		}
+		c.send(tenant, entries)
+	}
+}
+
+// send pushes entries for a single tenant from the async batch loop,
+// requeuing them (subject to the tenant's backoff gate) rather than dropping
+// them on failure.
+func (c *promtailClientWithForwardedLogsMetricCounter) send(tenant string, entries []pushEntry) {
+	c.mu.RLock()
+	host := c.host
+	c.mu.RUnlock()
+
+	if err := c.doSend(tenant, entries); err != nil {
+		level.Error(c.logger).Log("msg", "failed to push logs", "tenant", tenant, "err", err)
+		c.requeueOrDrop(host, tenant, entries)
+	}
+}
+
+// HandleSync pushes a single entry straight to Loki, bypassing the pending
+// batch entirely, and returns the real outcome instead of Handle's
+// fire-and-forget nil. pkg/buffer/wal_reader.go uses this (via
+// types.SyncHandler) so it only checkpoints past an entry Loki has actually
+// acknowledged, rather than one merely queued for a later flush.
+func (c *promtailClientWithForwardedLogsMetricCounter) HandleSync(ls model.LabelSet, t time.Time, s string) error {
+	select {
+	case <-c.stopped:
+		return fmt.Errorf("client stopped")
+	default:
+	}
+
+	c.mu.RLock()
+	host := c.host
+	c.mu.RUnlock()
+
+	tenant := tenantOf(ls)
+	if retryAfter, allowed := defaultBackoffController.allow(host, tenant); !allowed {
+		return &RateLimitedError{Host: host, Tenant: tenant, RetryAfter: retryAfter}
+	}
+
+	return c.doSend(tenant, []pushEntry{{ls: ls, t: t, s: s}})
+}
+
+// doSend performs the actual HTTP push for tenant's entries and reports the
+// outcome to defaultBackoffController, so a 429/5xx on this tenant's batch
+// doesn't affect any other tenant sharing the same host. It leaves deciding
+// what to do about a failure (requeue, drop, retry) to the caller.
+func (c *promtailClientWithForwardedLogsMetricCounter) doSend(tenant string, entries []pushEntry) error {
+	c.mu.RLock()
+	cfg := c.cfg
+	host := c.host
+	httpClient := c.httpClient
+	c.mu.RUnlock()
+
+	body, err := encodePushRequest(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode push request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, cfg.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	if tenant != "" {
+		req.Header.Set("X-Scope-OrgID", tenant)
+	} else if cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", cfg.TenantID)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		defaultBackoffController.observe(host, tenant, 0, 0)
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	defaultBackoffController.observe(host, tenant, resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After")))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("loki rejected push: status %d", resp.StatusCode)
+	}
+	metrics.ForwardedLogs.WithLabelValues(host).Add(float64(len(entries)))
+	return nil
+}
+
+// requeueOrDrop puts a failed batch back at the front of tenant's pending
+// queue so it is retried on the next flush, unless the tenant has since
+// entered (or remains in) backoff, in which case the batch is counted as
+// dropped instead of growing pending without bound while Loki is down.
+func (c *promtailClientWithForwardedLogsMetricCounter) requeueOrDrop(host, tenant string, entries []pushEntry) {
+	select {
+	case <-c.stopped:
+		return
+	default:
+	}
+
+	if _, allowed := defaultBackoffController.allow(host, tenant); !allowed {
+		metrics.DroppedLogs.WithLabelValues(host, tenant).Add(float64(len(entries)))
+		return
+	}
+
+	c.pendingMu.Lock()
+	c.pending[tenant] = append(entries, c.pending[tenant]...)
+	c.pendingMu.Unlock()
+}
+
+// encodePushRequest groups entries sharing a label set into logproto.Streams
+// and snappy-compresses the marshaled PushRequest, mirroring the wire format
+// pkg/server decodes on the receive side.
+func encodePushRequest(entries []pushEntry) ([]byte, error) {
+	streams := make(map[string]*logproto.Stream, len(entries))
+	order := make([]string, 0, len(entries))
+
+	for _, e := range entries {
+		key := e.ls.String()
+		st, ok := streams[key]
+		if !ok {
+			st = &logproto.Stream{Labels: key}
+			streams[key] = st
+			order = append(order, key)
+		}
+		st.Entries = append(st.Entries, logproto.Entry{Timestamp: e.t, Line: e.s})
+	}
+
+	req := &logproto.PushRequest{Streams: make([]logproto.Stream, 0, len(order))}
+	for _, key := range order {
+		req.Streams = append(req.Streams, *streams[key])
+	}
+
+	buf, err := proto.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal push request: %w", err)
+	}
+	return snappy.Encode(nil, buf), nil
+}
+
+// parseRetryAfter parses a Retry-After header, which may be either a number
+// of seconds or an HTTP date. It returns 0 if the header is absent or
+// unparseable, leaving the caller to fall back to its own backoff schedule.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// Stop the client, flushing any pending batches first.
 func (c *promtailClientWithForwardedLogsMetricCounter) Stop() {
-	c.lokiclient.Stop()
+	c.initiateStop(true)
 }
 
-// StopWait stops the client waiting all saved logs to be sent.
+// StopWait stops the client, flushing any pending batches first.
 func (c *promtailClientWithForwardedLogsMetricCounter) StopWait() {
-	c.lokiclient.Stop()
+	c.initiateStop(true)
+}
+
+// StopNow aborts the client immediately, dropping whatever entries are still
+// pending rather than waiting to flush them, and cancels the in-flight send
+// (if any) instead of waiting on it. Use this when Loki is unreachable and
+// the caller cannot afford to block on Stop/StopWait - including when
+// Stop/StopWait was already called and is itself stuck inside flush().
+func (c *promtailClientWithForwardedLogsMetricCounter) StopNow() {
+	c.initiateStop(false)
+}
+
+// initiateStop asks run() to exit, closing c.stop at most once so a second
+// Stop/StopWait/StopNow call composes safely instead of sending on a channel
+// nobody is left to receive from. flush only takes effect for whichever call
+// wins that race; regardless of who wins, a non-flushing call always cancels
+// the shared context so a send already blocked in flush() (started by an
+// earlier Stop/StopWait against an unreachable Loki) is interrupted rather
+// than left to hang forever.
+func (c *promtailClientWithForwardedLogsMetricCounter) initiateStop(flush bool) {
+	c.stopOnce.Do(func() {
+		close(c.stopped)
+		c.flushOnStop = flush
+		close(c.stop)
+	})
+
+	if !flush {
+		c.cancel()
+	}
+
+	<-c.done
+	c.cancel()
+}
+
+// ApplyConfig updates the target URL, tenant and transport settings in
+// place; there is no separate client to recreate since sends go straight
+// over HTTP.
+func (c *promtailClientWithForwardedLogsMetricCounter) ApplyConfig(newCfg *config.Config) error {
+	newLokiCfg := newCfg.ClientConfig.GrafanaLokiConfig
+
+	c.mu.Lock()
+	c.cfg = newLokiCfg
+	c.host = newLokiCfg.URL.Hostname()
+	c.httpClient = &http.Client{Timeout: newLokiCfg.Timeout}
+	c.mu.Unlock()
+	return nil
 }
 
 type removeTenantIdClient struct {
@@ -120,6 +448,20 @@ func (c *removeTenantIdClient) Handle(ls model.LabelSet, t time.Time, s string)
 	return c.lokiclient.Handle(ls, t, s)
 }
 
+// HandleSync mirrors Handle, but delegates to the wrapped client's
+// types.SyncHandler when it implements one so a real delivery acknowledgment
+// still propagates through this wrapper.
+func (c *removeTenantIdClient) HandleSync(ls model.LabelSet, t time.Time, s string) error {
+	if _, ok := ls[client.ReservedLabelTenantID]; ok {
+		return nil
+	}
+	delete(ls, MultiTenantClientLabel)
+	if sh, ok := c.lokiclient.(types.SyncHandler); ok {
+		return sh.HandleSync(ls, t, s)
+	}
+	return c.lokiclient.Handle(ls, t, s)
+}
+
 // Stop the client.
 func (c *removeTenantIdClient) Stop() {
 	c.lokiclient.Stop()
@@ -127,5 +469,16 @@ func (c *removeTenantIdClient) Stop() {
 
 // StopWait stops the client waiting all saved logs to be sent.
 func (c *removeTenantIdClient) StopWait() {
-	c.lokiclient.Stop()
+	c.lokiclient.StopWait()
+}
+
+// StopNow aborts the client immediately.
+func (c *removeTenantIdClient) StopNow() {
+	c.lokiclient.StopNow()
+}
+
+// ApplyConfig passes the new config through to the wrapped client; this
+// wrapper has no state of its own to update.
+func (c *removeTenantIdClient) ApplyConfig(newCfg *config.Config) error {
+	return c.lokiclient.ApplyConfig(newCfg)
 }
@@ -0,0 +1,122 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gardener/logging/pkg/config"
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/grafana/loki/pkg/promtail/client"
+	"github.com/prometheus/common/model"
+)
+
+// MultiTenantClientLabel is the label whose value holds a `|`-separated list
+// of tenant IDs a log line should be re-emitted for.
+const MultiTenantClientLabel = "__gardener_multitenant_id__"
+
+const tenantIDSeparator = "|"
+
+type multiTenantClient struct {
+	lokiclient               types.LokiClient
+	preserveMultiTenantLabel bool
+}
+
+// NewMultiTenantClientWrapper returns a client which forwards a copy of the
+// log entry to the wrapped client for every tenant ID found under
+// MultiTenantClientLabel, stamping each copy with client.ReservedLabelTenantID.
+// If preserveMultiTenantLabel is false, MultiTenantClientLabel is stripped
+// before forwarding.
+func NewMultiTenantClientWrapper(clientToWrap types.LokiClient, preserveMultiTenantLabel bool) types.LokiClient {
+	return &multiTenantClient{
+		lokiclient:               clientToWrap,
+		preserveMultiTenantLabel: preserveMultiTenantLabel,
+	}
+}
+
+func (c *multiTenantClient) Handle(ls model.LabelSet, t time.Time, s string) error {
+	tenantIDs, ok := ls[MultiTenantClientLabel]
+	if !ok {
+		return c.lokiclient.Handle(ls, t, s)
+	}
+
+	if !c.preserveMultiTenantLabel {
+		delete(ls, MultiTenantClientLabel)
+	}
+
+	var lastErr error
+	for _, tenantID := range strings.Split(string(tenantIDs), tenantIDSeparator) {
+		tenantLs := ls.Clone()
+		tenantLs[client.ReservedLabelTenantID] = model.LabelValue(tenantID)
+		if err := c.lokiclient.Handle(tenantLs, t, s); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// HandleSync mirrors Handle, but delegates to the wrapped client's
+// types.SyncHandler when it implements one so a real delivery acknowledgment
+// still propagates through this wrapper.
+func (c *multiTenantClient) HandleSync(ls model.LabelSet, t time.Time, s string) error {
+	tenantIDs, ok := ls[MultiTenantClientLabel]
+	if !ok {
+		return c.handleSync(ls, t, s)
+	}
+
+	if !c.preserveMultiTenantLabel {
+		delete(ls, MultiTenantClientLabel)
+	}
+
+	var lastErr error
+	for _, tenantID := range strings.Split(string(tenantIDs), tenantIDSeparator) {
+		tenantLs := ls.Clone()
+		tenantLs[client.ReservedLabelTenantID] = model.LabelValue(tenantID)
+		if err := c.handleSync(tenantLs, t, s); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (c *multiTenantClient) handleSync(ls model.LabelSet, t time.Time, s string) error {
+	if sh, ok := c.lokiclient.(types.SyncHandler); ok {
+		return sh.HandleSync(ls, t, s)
+	}
+	return c.lokiclient.Handle(ls, t, s)
+}
+
+// Stop the client.
+func (c *multiTenantClient) Stop() {
+	c.lokiclient.Stop()
+}
+
+// StopWait stops the client waiting all saved logs to be sent.
+func (c *multiTenantClient) StopWait() {
+	c.lokiclient.StopWait()
+}
+
+// StopNow aborts the client immediately.
+func (c *multiTenantClient) StopNow() {
+	c.lokiclient.StopNow()
+}
+
+// ApplyConfig passes the new config through to the wrapped client; this
+// wrapper has no state of its own to update.
+func (c *multiTenantClient) ApplyConfig(newCfg *config.Config) error {
+	return c.lokiclient.ApplyConfig(newCfg)
+}
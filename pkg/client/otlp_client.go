@@ -0,0 +1,397 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gardener/logging/pkg/config"
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/grafana/loki/pkg/promtail/client"
+	"github.com/prometheus/common/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	otlpProtocolHTTP = "http"
+	otlpProtocolGRPC = "grpc"
+
+	defaultOTLPBatchSize = 100
+	defaultOTLPBatchWait = 1 * time.Second
+
+	// defaultOTLPDialTimeout bounds how long NewOTLPClient waits to establish
+	// the gRPC connection when cfg.Timeout isn't set, so an unreachable
+	// collector can't hang client (and fluent-bit) startup indefinitely.
+	defaultOTLPDialTimeout = 10 * time.Second
+
+	// otlpTenantResourceAttribute is the resource attribute the reserved
+	// __tenant_id__ label is mapped to on export.
+	otlpTenantResourceAttribute = "loki.tenant.id"
+)
+
+type otlpEntry struct {
+	ls model.LabelSet
+	t  time.Time
+	s  string
+}
+
+// otlpClient batches entries into OTLP ExportLogsServiceRequest messages and
+// ships them to an OpenTelemetry collector over OTLP/HTTP or OTLP/gRPC, as
+// an alternative to the Loki push protocol. It satisfies types.LokiClient so
+// it composes under removeTenantIdClient, multiTenantClient and the buffer
+// wrappers unchanged.
+type otlpClient struct {
+	logger   log.Logger
+	protocol string
+
+	mu         sync.Mutex
+	endpoint   string
+	headers    map[string]string
+	httpClient *http.Client
+	grpcConn   *grpc.ClientConn
+	grpcClient collogspb.LogsServiceClient
+
+	pendingMu sync.Mutex
+	pending   []otlpEntry
+	batchSize int
+	batchWait time.Duration
+
+	// quit carries whether the pending batch should be flushed before the
+	// run loop returns: true for Stop/StopWait, false for StopNow.
+	quit chan bool
+	done chan struct{}
+}
+
+// NewOTLPClient returns a types.LokiClient which exports entries to an
+// OpenTelemetry collector instead of pushing them to Loki.
+func NewOTLPClient(cfg config.OTLPConfig, logger log.Logger) (types.LokiClient, error) {
+	protocol := cfg.Protocol
+	if protocol == "" {
+		protocol = otlpProtocolHTTP
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultOTLPBatchSize
+	}
+	batchWait := cfg.BatchWait
+	if batchWait <= 0 {
+		batchWait = defaultOTLPBatchWait
+	}
+
+	c := &otlpClient{
+		logger:    logger,
+		protocol:  protocol,
+		endpoint:  cfg.Endpoint,
+		headers:   cfg.Headers,
+		batchSize: batchSize,
+		batchWait: batchWait,
+		quit:      make(chan bool),
+		done:      make(chan struct{}),
+	}
+
+	switch protocol {
+	case otlpProtocolHTTP:
+		c.httpClient = &http.Client{Timeout: cfg.Timeout}
+	case otlpProtocolGRPC:
+		dialTimeout := cfg.Timeout
+		if dialTimeout <= 0 {
+			dialTimeout = defaultOTLPDialTimeout
+		}
+		conn, err := dialOTLPCollector(cfg.Endpoint, cfg.Insecure, dialTimeout)
+		if err != nil {
+			return nil, err
+		}
+		c.grpcConn = conn
+		c.grpcClient = collogspb.NewLogsServiceClient(conn)
+	default:
+		return nil, fmt.Errorf("otlp: unknown protocol %q", protocol)
+	}
+
+	go c.run()
+	return c, nil
+}
+
+// dialOTLPCollector blocks until the connection is established or timeout
+// elapses, rather than hanging forever, so a collector that is down when the
+// client starts doesn't wedge NewOTLPClient (and the fluent-bit process
+// starting it).
+func dialOTLPCollector(endpoint string, insecureConn bool, timeout time.Duration) (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	opts := []grpc.DialOption{grpc.WithBlock()}
+	if insecureConn {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	conn, err := grpc.DialContext(ctx, endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("otlp: failed to dial collector: %w", err)
+	}
+	return conn, nil
+}
+
+func (c *otlpClient) Handle(ls model.LabelSet, t time.Time, s string) error {
+	c.pendingMu.Lock()
+	c.pending = append(c.pending, otlpEntry{ls: ls, t: t, s: s})
+	full := len(c.pending) >= c.batchSize
+	c.pendingMu.Unlock()
+
+	if full {
+		c.flush()
+	}
+	return nil
+}
+
+// HandleSync exports a single entry immediately, bypassing the pending
+// batch, and returns the real export outcome instead of Handle's
+// fire-and-forget nil. pkg/buffer/wal_reader.go uses this (via
+// types.SyncHandler) so it only checkpoints past an entry the collector has
+// actually acknowledged.
+func (c *otlpClient) HandleSync(ls model.LabelSet, t time.Time, s string) error {
+	return c.export(buildExportRequest([]otlpEntry{{ls: ls, t: t, s: s}}))
+}
+
+func (c *otlpClient) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.batchWait)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case flush := <-c.quit:
+			if flush {
+				c.flush()
+			}
+			return
+		}
+	}
+}
+
+func (c *otlpClient) flush() {
+	c.pendingMu.Lock()
+	batch := c.pending
+	c.pending = nil
+	c.pendingMu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := c.export(buildExportRequest(batch)); err != nil {
+		level.Error(c.logger).Log("msg", "otlp: failed to export logs", "err", err)
+	}
+}
+
+// buildExportRequest maps entries sharing a label set to a single
+// ResourceLogs entry, translating labels into Resource attributes (with
+// __tenant_id__ mapped to otlpTenantResourceAttribute) and the log line into
+// the LogRecord body.
+func buildExportRequest(entries []otlpEntry) *collogspb.ExportLogsServiceRequest {
+	resourceLogs := make(map[string]*logspb.ResourceLogs, len(entries))
+	order := make([]string, 0, len(entries))
+
+	for _, e := range entries {
+		key := e.ls.String()
+		rl, ok := resourceLogs[key]
+		if !ok {
+			rl = &logspb.ResourceLogs{
+				Resource:  &resourcepb.Resource{Attributes: labelSetToAttributes(e.ls)},
+				ScopeLogs: []*logspb.ScopeLogs{{}},
+			}
+			resourceLogs[key] = rl
+			order = append(order, key)
+		}
+
+		rl.ScopeLogs[0].LogRecords = append(rl.ScopeLogs[0].LogRecords, &logspb.LogRecord{
+			TimeUnixNano: uint64(e.t.UnixNano()),
+			Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: e.s}},
+		})
+	}
+
+	req := &collogspb.ExportLogsServiceRequest{ResourceLogs: make([]*logspb.ResourceLogs, 0, len(order))}
+	for _, key := range order {
+		req.ResourceLogs = append(req.ResourceLogs, resourceLogs[key])
+	}
+	return req
+}
+
+func labelSetToAttributes(ls model.LabelSet) []*commonpb.KeyValue {
+	attrs := make([]*commonpb.KeyValue, 0, len(ls))
+	for name, value := range ls {
+		key := string(name)
+		if key == string(client.ReservedLabelTenantID) {
+			key = otlpTenantResourceAttribute
+		}
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key:   key,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: string(value)}},
+		})
+	}
+	return attrs
+}
+
+func (c *otlpClient) export(req *collogspb.ExportLogsServiceRequest) error {
+	c.mu.Lock()
+	protocol := c.protocol
+	c.mu.Unlock()
+
+	if protocol == otlpProtocolGRPC {
+		return c.exportGRPC(req)
+	}
+	return c.exportHTTP(req)
+}
+
+func (c *otlpClient) exportGRPC(req *collogspb.ExportLogsServiceRequest) error {
+	c.mu.Lock()
+	grpcClient := c.grpcClient
+	timeout := c.batchWait
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := grpcClient.Export(ctx, req)
+	return err
+}
+
+func (c *otlpClient) exportHTTP(req *collogspb.ExportLogsServiceRequest) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("otlp: failed to marshal export request: %w", err)
+	}
+
+	c.mu.Lock()
+	endpoint := c.endpoint
+	headers := c.headers
+	httpClient := c.httpClient
+	c.mu.Unlock()
+
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp: collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Stop the client.
+func (c *otlpClient) Stop() {
+	c.quit <- true
+	<-c.done
+	c.closeTransport()
+}
+
+// StopWait stops the client, flushing the pending batch first.
+func (c *otlpClient) StopWait() {
+	c.quit <- true
+	<-c.done
+	c.closeTransport()
+}
+
+// StopNow stops the client without flushing, dropping whatever entries are
+// still waiting to be batched and sent. If an export is already in progress,
+// StopNow waits for it to return; that export is not cancelled.
+func (c *otlpClient) StopNow() {
+	c.quit <- false
+	<-c.done
+	c.closeTransport()
+}
+
+func (c *otlpClient) closeTransport() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.grpcConn != nil {
+		_ = c.grpcConn.Close()
+	}
+}
+
+// ApplyConfig updates the endpoint and headers in place. Switching Exporter
+// away from OTLP or changing the OTLP protocol is incompatible with an
+// in-place swap and requires recreating the client.
+func (c *otlpClient) ApplyConfig(newCfg *config.Config) error {
+	if newCfg.ClientConfig.Exporter != config.OTLPExporter {
+		return fmt.Errorf("cannot apply config: Exporter changed, client must be recreated")
+	}
+
+	newOTLPCfg := newCfg.ClientConfig.OTLPConfig
+	protocol := newOTLPCfg.Protocol
+	if protocol == "" {
+		protocol = otlpProtocolHTTP
+	}
+	if protocol != c.protocol {
+		return fmt.Errorf("cannot apply config: otlp protocol changed, client must be recreated")
+	}
+
+	if protocol == otlpProtocolGRPC && newOTLPCfg.Endpoint != c.endpoint {
+		dialTimeout := newOTLPCfg.Timeout
+		if dialTimeout <= 0 {
+			dialTimeout = defaultOTLPDialTimeout
+		}
+		conn, err := dialOTLPCollector(newOTLPCfg.Endpoint, newOTLPCfg.Insecure, dialTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to apply config: %w", err)
+		}
+
+		c.mu.Lock()
+		old := c.grpcConn
+		c.grpcConn = conn
+		c.grpcClient = collogspb.NewLogsServiceClient(conn)
+		c.endpoint = newOTLPCfg.Endpoint
+		c.headers = newOTLPCfg.Headers
+		c.mu.Unlock()
+
+		_ = old.Close()
+		return nil
+	}
+
+	c.mu.Lock()
+	c.endpoint = newOTLPCfg.Endpoint
+	c.headers = newOTLPCfg.Headers
+	c.mu.Unlock()
+	return nil
+}
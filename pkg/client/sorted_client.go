@@ -0,0 +1,240 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gardener/logging/pkg/config"
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/promtail/api"
+	"github.com/grafana/loki/pkg/promtail/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// reRegisterer wraps a prometheus.Registerer so that registering a
+// collector that collides with one already registered (as happens when
+// ApplyConfig calls client.New again across a config reload, re-registering
+// the wrapped promtail client's fixed-name metrics) reuses the existing
+// registration instead of failing.
+type reRegisterer struct {
+	prometheus.Registerer
+}
+
+func (r reRegisterer) Register(c prometheus.Collector) error {
+	if err := r.Registerer.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (r reRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+type sortedEntry struct {
+	ls model.LabelSet
+	t  time.Time
+	s  string
+}
+
+// sortedClient buffers incoming entries in memory for up to the configured
+// batch wait and forwards them to the wrapped promtail client ordered by
+// timestamp, so that logs arriving out of order at the fluent-bit input
+// don't get rejected by Loki's per-stream ordering constraint.
+type sortedClient struct {
+	clientMu   sync.RWMutex
+	lokiclient client.Client
+	logger     log.Logger
+
+	numberOfBatchIDs uint64
+	mu               []sync.Mutex
+	entries          [][]sortedEntry
+
+	waitCheckFrequency time.Duration
+	maxWaitTime        time.Duration
+	// quit carries whether pending entries should be flushed before the run
+	// loop returns: true for Stop/StopWait, false for StopNow.
+	quit chan bool
+	done chan struct{}
+}
+
+// newSortedClient returns a types.LokiClient which sorts entries by
+// timestamp, within numberOfBatchIDs parallel shards, before forwarding them
+// to the underlying promtail client.
+func newSortedClient(cfg client.Config, numberOfBatchIDs uint64, logger log.Logger) (types.LokiClient, error) {
+	c, err := client.New(reRegisterer{prometheus.DefaultRegisterer}, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if numberOfBatchIDs == 0 {
+		numberOfBatchIDs = 1
+	}
+
+	waitCheckFrequency := cfg.BatchWait / waitCheckFrequencyDelimiter
+	if waitCheckFrequency < minWaitCheckFrequency {
+		waitCheckFrequency = minWaitCheckFrequency
+	}
+
+	sc := &sortedClient{
+		lokiclient:         c,
+		logger:             logger,
+		numberOfBatchIDs:   numberOfBatchIDs,
+		mu:                 make([]sync.Mutex, numberOfBatchIDs),
+		entries:            make([][]sortedEntry, numberOfBatchIDs),
+		waitCheckFrequency: waitCheckFrequency,
+		maxWaitTime:        cfg.BatchWait,
+		quit:               make(chan bool),
+		done:               make(chan struct{}),
+	}
+
+	go sc.run()
+
+	return sc, nil
+}
+
+func (c *sortedClient) shard(ls model.LabelSet) uint64 {
+	return uint64(ls.FastFingerprint()) % uint64(len(c.entries))
+}
+
+func (c *sortedClient) Handle(ls model.LabelSet, t time.Time, s string) error {
+	shard := c.shard(ls)
+	c.mu[shard].Lock()
+	c.entries[shard] = append(c.entries[shard], sortedEntry{ls: ls, t: t, s: s})
+	c.mu[shard].Unlock()
+	return nil
+}
+
+func (c *sortedClient) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.waitCheckFrequency)
+	defer ticker.Stop()
+
+	lastFlush := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			if time.Since(lastFlush) >= c.maxWaitTime {
+				c.flush()
+				lastFlush = time.Now()
+			}
+		case flush := <-c.quit:
+			if flush {
+				c.flush()
+			}
+			return
+		}
+	}
+}
+
+func (c *sortedClient) flush() {
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+
+	for shard := range c.entries {
+		c.mu[shard].Lock()
+		batch := c.entries[shard]
+		c.entries[shard] = nil
+		c.mu[shard].Unlock()
+
+		sort.Slice(batch, func(i, j int) bool { return batch[i].t.Before(batch[j].t) })
+		for _, e := range batch {
+			c.lokiclient.Chan() <- api.Entry{Labels: e.ls, Entry: logproto.Entry{Timestamp: e.t, Line: e.s}}
+		}
+	}
+}
+
+// Stop the client.
+func (c *sortedClient) Stop() {
+	c.quit <- true
+	<-c.done
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+	c.lokiclient.Stop()
+}
+
+// StopWait stops the client waiting all saved logs to be sent.
+func (c *sortedClient) StopWait() {
+	c.quit <- true
+	<-c.done
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+	c.lokiclient.Stop()
+}
+
+// StopNow aborts the client immediately, dropping whatever entries are still
+// waiting to be sorted and sent. The wrapped client is stopped in the
+// background, without waiting for it. If a flush is already in progress,
+// StopNow waits for that flush to finish handing its entries to the wrapped
+// client; the flush is not cancelled.
+func (c *sortedClient) StopNow() {
+	c.quit <- false
+	<-c.done
+	c.clientMu.RLock()
+	defer c.clientMu.RUnlock()
+	go c.lokiclient.Stop()
+}
+
+// ApplyConfig swaps the underlying promtail client for one built from
+// newCfg's GrafanaLokiConfig. Changing SortByTimestamp or NumberOfBatchIDs
+// is incompatible with an in-place swap, since it would require resizing
+// the shard set out from under in-flight Handle calls, so it is rejected.
+func (c *sortedClient) ApplyConfig(newCfg *config.Config) error {
+	if !newCfg.ClientConfig.SortByTimestamp {
+		return fmt.Errorf("cannot apply config: SortByTimestamp changed, client must be recreated")
+	}
+	newNumberOfBatchIDs := newCfg.ClientConfig.NumberOfBatchIDs
+	if newNumberOfBatchIDs == 0 {
+		newNumberOfBatchIDs = 1
+	}
+	if newNumberOfBatchIDs != c.numberOfBatchIDs {
+		return fmt.Errorf("cannot apply config: NumberOfBatchIDs changed, client must be recreated")
+	}
+
+	// Registered on prometheus.DefaultRegisterer (via reRegisterer), not a
+	// throwaway registry, so the swapped client's counters (host label
+	// included) keep being served from the real /metrics endpoint instead of
+	// going to a registry nobody scrapes.
+	newLokiClient, err := client.New(reRegisterer{prometheus.DefaultRegisterer}, newCfg.ClientConfig.GrafanaLokiConfig, c.logger)
+	if err != nil {
+		return fmt.Errorf("failed to apply config: %w", err)
+	}
+
+	c.clientMu.Lock()
+	old := c.lokiclient
+	c.lokiclient = newLokiClient
+	c.clientMu.Unlock()
+
+	go old.Stop()
+	return nil
+}
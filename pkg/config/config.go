@@ -0,0 +1,85 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"time"
+
+	"github.com/grafana/loki/pkg/promtail/client"
+)
+
+// OTLPExporter selects the OTLP exporter in ClientConfig.Exporter, as an
+// alternative to the default Loki push protocol.
+const OTLPExporter = "otlp"
+
+// Config is the root configuration consumed by client.NewClient to assemble
+// the types.LokiClient chain for a fluent-bit output instance.
+type Config struct {
+	ClientConfig ClientConfig
+}
+
+// ClientConfig bundles the knobs that influence how the client chain is
+// assembled and how it talks to Loki.
+type ClientConfig struct {
+	// GrafanaLokiConfig is the promtail client configuration used to talk to Loki.
+	GrafanaLokiConfig client.Config
+	// BufferConfig controls whether and how logs are buffered on disk.
+	BufferConfig BufferConfig
+	// SortByTimestamp enables the sortedClient wrapper.
+	SortByTimestamp bool
+	// NumberOfBatchIDs is the number of parallel batch buckets the sortedClient keeps.
+	NumberOfBatchIDs uint64
+	// Exporter selects which protocol the leaf client speaks: "" (default)
+	// for the Loki push protocol, or OTLPExporter to ship logs to an
+	// OpenTelemetry collector instead.
+	Exporter string
+	// OTLPConfig configures the OTLP exporter. Only used when Exporter is
+	// OTLPExporter.
+	OTLPConfig OTLPConfig
+}
+
+// OTLPConfig configures the OTLP logs exporter.
+type OTLPConfig struct {
+	// Endpoint is the OTLP/HTTP or OTLP/gRPC collector endpoint to export to.
+	Endpoint string
+	// Protocol selects the transport: "http" (default) or "grpc".
+	Protocol string
+	// Headers are added to every export request (e.g. authentication).
+	Headers map[string]string
+	// Insecure disables transport security for the gRPC protocol.
+	Insecure bool
+	// Timeout bounds a single export call over HTTP and, for gRPC, the
+	// initial connection; a gRPC export call is bounded by BatchWait.
+	Timeout time.Duration
+	// BatchWait is the maximum time entries are held before being exported.
+	BatchWait time.Duration
+	// BatchSize is the maximum number of entries held before being exported.
+	BatchSize int
+}
+
+// BufferConfig controls whether and how logs are buffered on disk between
+// fluent-bit and the wrapped client chain.
+type BufferConfig struct {
+	// Buffer enables buffering logs on disk before forwarding them.
+	Buffer bool
+	// BufferType selects the buffer implementation, e.g. "dque" or "wal".
+	BufferType string
+	// BufferDir is the directory the on-disk buffer keeps its segments in.
+	BufferDir string
+	// WALSegmentSize is the size in bytes at which the "wal" buffer rotates
+	// to a new segment. Only used when BufferType is "wal"; defaults to
+	// 256MB when zero.
+	WALSegmentSize int64
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ForwardedLogs counts the log lines successfully handed off to the
+// downstream client, labeled by the target Loki host.
+var ForwardedLogs = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "fluentbit",
+	Subsystem: "loki",
+	Name:      "forwarded_logs_total",
+	Help:      "Total number of logs forwarded to the loki client.",
+}, []string{"host"})
+
+// DroppedLogs counts log lines dropped because the tenant they belong to was
+// within a rate-limit backoff window.
+var DroppedLogs = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "fluentbit",
+	Subsystem: "loki",
+	Name:      "dropped_logs_total",
+	Help:      "Total number of logs dropped because the tenant was backing off, labeled by host and tenant.",
+}, []string{"host", "tenant"})
+
+// RetriedLogs counts send attempts that hit a retryable 429 or 5xx response,
+// or got no response at all, and put the tenant into backoff.
+var RetriedLogs = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "fluentbit",
+	Subsystem: "loki",
+	Name:      "retried_logs_total",
+	Help:      "Total number of send attempts that hit a retryable response or got no response, labeled by host and tenant.",
+}, []string{"host", "tenant"})
+
+// TenantBackoffSeconds reports the length, in seconds, of the backoff window
+// most recently started for a tenant. It is set back to 0 when a send for the
+// tenant gets a non-retryable response; it does not count down while the
+// window runs.
+var TenantBackoffSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "fluentbit",
+	Subsystem: "loki",
+	Name:      "tenant_backoff_seconds",
+	Help:      "Length in seconds of the backoff window most recently started for a tenant, labeled by host and tenant.",
+}, []string{"host", "tenant"})
+
+func init() {
+	prometheus.MustRegister(ForwardedLogs)
+	prometheus.MustRegister(DroppedLogs)
+	prometheus.MustRegister(RetriedLogs)
+	prometheus.MustRegister(TenantBackoffSeconds)
+}
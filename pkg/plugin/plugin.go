@@ -0,0 +1,58 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin bridges the fluent-bit output plugin lifecycle callbacks
+// (FLBPluginInit/FLBPluginFlush/FLBPluginExit, implemented in the cmd/
+// entrypoint that cgo-exports them) onto the types.LokiClient chain built by
+// client.NewClient.
+package plugin
+
+import (
+	"time"
+
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// defaultShutdownTimeout is used when the caller passes a shutdownTimeout
+// <= 0.
+const defaultShutdownTimeout = 10 * time.Second
+
+// FLBPluginExit drains lokiclient for up to shutdownTimeout, supplied by the
+// caller, before aborting it.
+// This is what a cmd/ fluent-bit-go entrypoint's FLBPluginExit should call:
+// it lets shutdown pick between a graceful StopWait drain and an immediate
+// StopNow abort, so a fluent-bit pod stuck retrying against an unreachable
+// Loki doesn't hang the process shutdown indefinitely. shutdownTimeout <= 0
+// falls back to defaultShutdownTimeout.
+func FLBPluginExit(lokiclient types.LokiClient, shutdownTimeout time.Duration, logger log.Logger) {
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+
+	done := make(chan struct{})
+	go func() {
+		lokiclient.StopWait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		level.Warn(logger).Log("msg", "plugin: graceful shutdown timed out, aborting", "timeout", shutdownTimeout)
+		lokiclient.StopNow()
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gardener/logging/pkg/config"
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// WatchConfigReload re-reads configPath and calls lokiclient.ApplyConfig
+// every time the process receives SIGHUP, so a fluent-bit pod whose config
+// file (or mounted ConfigMap) changes can be retargeted at a different Loki
+// without restarting and losing whatever is sitting in its buffer. It runs
+// until stop is closed; callers typically start it in its own goroutine
+// from FLBPluginInit and close stop from FLBPluginExit.
+func WatchConfigReload(configPath string, lokiclient types.LokiClient, logger log.Logger, stop <-chan struct{}) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-sighup:
+			newCfg, err := config.LoadFile(configPath)
+			if err != nil {
+				level.Error(logger).Log("msg", "plugin: failed to reload config on SIGHUP", "path", configPath, "err", err)
+				continue
+			}
+			if err := lokiclient.ApplyConfig(newCfg); err != nil {
+				level.Error(logger).Log("msg", "plugin: failed to apply reloaded config", "path", configPath, "err", err)
+				continue
+			}
+			level.Info(logger).Log("msg", "plugin: applied reloaded config", "path", configPath)
+		}
+	}
+}
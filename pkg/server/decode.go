@@ -0,0 +1,135 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+)
+
+// pushStream is the decoded, protocol-agnostic form of a single stream from
+// a push request.
+type pushStream struct {
+	labels  model.LabelSet
+	entries []logproto.Entry
+}
+
+// decodePush reads and decodes the body of a push request, supporting both
+// the standard snappy-compressed protobuf encoding and the JSON variant.
+func decodePush(r *http.Request) ([]pushStream, error) {
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close() //nolint:errcheck
+
+	if err != nil {
+		return nil, fmt.Errorf("server: failed to read request body: %w", err)
+	}
+
+	if strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		return decodeJSONPush(body)
+	}
+	return decodeProtoPush(body)
+}
+
+func decodeProtoPush(body []byte) ([]pushStream, error) {
+	decoded, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("server: failed to snappy-decode push request: %w", err)
+	}
+
+	var req logproto.PushRequest
+	if err := proto.Unmarshal(decoded, &req); err != nil {
+		return nil, fmt.Errorf("server: failed to unmarshal push request: %w", err)
+	}
+
+	streams := make([]pushStream, 0, len(req.Streams))
+	for _, s := range req.Streams {
+		ls, err := parseLabelSet(s.Labels)
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, pushStream{labels: ls, entries: s.Entries})
+	}
+	return streams, nil
+}
+
+type jsonPushRequest struct {
+	Streams []jsonPushStream `json:"streams"`
+}
+
+type jsonPushStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func decodeJSONPush(body []byte) ([]pushStream, error) {
+	var req jsonPushRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("server: failed to unmarshal json push request: %w", err)
+	}
+
+	streams := make([]pushStream, 0, len(req.Streams))
+	for _, s := range req.Streams {
+		ls := make(model.LabelSet, len(s.Stream))
+		for k, v := range s.Stream {
+			ls[model.LabelName(k)] = model.LabelValue(v)
+		}
+
+		entries := make([]logproto.Entry, 0, len(s.Values))
+		for _, v := range s.Values {
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("server: invalid timestamp %q: %w", v[0], err)
+			}
+			entries = append(entries, logproto.Entry{Timestamp: time.Unix(0, ns), Line: v[1]})
+		}
+		streams = append(streams, pushStream{labels: ls, entries: entries})
+	}
+	return streams, nil
+}
+
+// parseLabelSet parses the Prometheus-style label string Loki streams carry
+// (e.g. `{foo="bar", baz="qux"}`) into a model.LabelSet.
+func parseLabelSet(raw string) (model.LabelSet, error) {
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimPrefix(raw, "{")
+	raw = strings.TrimSuffix(raw, "}")
+	raw = strings.TrimSpace(raw)
+
+	ls := model.LabelSet{}
+	if raw == "" {
+		return ls, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("server: invalid label pair %q", pair)
+		}
+		name := strings.TrimSpace(kv[0])
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		ls[model.LabelName(name)] = model.LabelValue(value)
+	}
+	return ls, nil
+}
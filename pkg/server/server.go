@@ -0,0 +1,116 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server exposes a Loki-compatible push endpoint so that
+// gardener/logging can act as an aggregation hop other agents (promtail,
+// docker-driver, other fluent-bits) push logs to, reusing the buffering,
+// sorting and multi-tenant routing already built into the pkg/client chain
+// instead of every pod talking to Loki directly.
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gardener/logging/pkg/types"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/grafana/loki/pkg/promtail/client"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	pushPath = "/loki/api/v1/push"
+
+	// tenantIDHeader is the header Loki's push clients set to identify the
+	// tenant a stream belongs to.
+	tenantIDHeader = "X-Scope-OrgID"
+)
+
+// Server exposes a /loki/api/v1/push endpoint and forwards every decoded
+// entry through lokiclient.
+type Server struct {
+	lokiclient types.LokiClient
+	logger     log.Logger
+	httpServer *http.Server
+}
+
+// NewServer returns a Server which, once started, listens on addr and
+// forwards every pushed entry to lokiclient.
+func NewServer(addr string, lokiclient types.LokiClient, logger log.Logger) *Server {
+	s := &Server{
+		lokiclient: lokiclient,
+		logger:     logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(pushPath, s.handlePush)
+	s.httpServer = &http.Server{Addr: addr, Handler: mux}
+
+	return s
+}
+
+// ListenAndServe starts serving push requests. It blocks until the server
+// is shut down or fails to start.
+func (s *Server) ListenAndServe() error {
+	return s.httpServer.ListenAndServe()
+}
+
+// Shutdown gracefully stops the HTTP server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	streams, err := decodePush(r)
+	if err != nil {
+		level.Error(s.logger).Log("msg", "server: failed to decode push request", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tenantID := r.Header.Get(tenantIDHeader)
+
+	var failed, rateLimited bool
+	for _, stream := range streams {
+		for _, e := range stream.entries {
+			ls := stream.labels.Clone()
+			if tenantID != "" {
+				ls[client.ReservedLabelTenantID] = model.LabelValue(tenantID)
+			}
+			if err := s.lokiclient.Handle(ls, e.Timestamp, e.Line); err != nil {
+				level.Error(s.logger).Log("msg", "server: failed to forward pushed entry", "err", err)
+				failed = true
+				var retryable types.RetryableError
+				if errors.As(err, &retryable) {
+					rateLimited = true
+				}
+			}
+		}
+	}
+
+	switch {
+	case rateLimited:
+		// Surface a retryable status so upstream pushers (promtail,
+		// docker-driver, other fluent-bits) back off and resend instead of
+		// silently losing the batch, mirroring Loki's own 429 behavior.
+		http.Error(w, "downstream tenant is rate-limited, retry later", http.StatusTooManyRequests)
+	case failed:
+		http.Error(w, "failed to forward one or more entries", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
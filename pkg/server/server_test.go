@@ -0,0 +1,92 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gardener/logging/pkg/config"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+)
+
+// fakeLokiClient is a minimal types.LokiClient stand-in that lets tests
+// script the error Handle returns.
+type fakeLokiClient struct {
+	handleErr error
+}
+
+func (c *fakeLokiClient) Handle(_ model.LabelSet, _ time.Time, _ string) error { return c.handleErr }
+func (c *fakeLokiClient) Stop()                                               {}
+func (c *fakeLokiClient) StopWait()                                           {}
+func (c *fakeLokiClient) StopNow()                                            {}
+func (c *fakeLokiClient) ApplyConfig(_ *config.Config) error                  { return nil }
+
+type retryableErr struct{ delay time.Duration }
+
+func (e *retryableErr) Error() string        { return "retryable" }
+func (e *retryableErr) Delay() time.Duration { return e.delay }
+
+func pushBody() string {
+	return `{"streams":[{"stream":{"app":"foo"},"values":[["1","hello"]]}]}`
+}
+
+func TestHandlePushSuccess(t *testing.T) {
+	s := NewServer(":0", &fakeLokiClient{}, log.NewNopLogger())
+
+	req := httptest.NewRequest(http.MethodPost, pushPath, strings.NewReader(pushBody()))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handlePush(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+func TestHandlePushSurfacesRateLimitAs429(t *testing.T) {
+	s := NewServer(":0", &fakeLokiClient{handleErr: &retryableErr{delay: time.Second}}, log.NewNopLogger())
+
+	req := httptest.NewRequest(http.MethodPost, pushPath, strings.NewReader(pushBody()))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handlePush(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestHandlePushSurfacesOtherFailureAs5xx(t *testing.T) {
+	s := NewServer(":0", &fakeLokiClient{handleErr: fmt.Errorf("boom")}, log.NewNopLogger())
+
+	req := httptest.NewRequest(http.MethodPost, pushPath, strings.NewReader(pushBody()))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handlePush(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
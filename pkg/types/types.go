@@ -0,0 +1,67 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"time"
+
+	"github.com/gardener/logging/pkg/config"
+
+	"github.com/prometheus/common/model"
+)
+
+// LokiClient is the interface every client wrapper in pkg/client implements
+// in order to forward fluent-bit records towards Loki.
+type LokiClient interface {
+	// Handle processes and forwards the log entry carrying the given label
+	// set, timestamp and log line.
+	Handle(ls model.LabelSet, t time.Time, s string) error
+	// Stop shuts down the client, first flushing entries it still holds in
+	// memory.
+	Stop()
+	// StopWait shuts down the client, blocking until already accepted logs
+	// have been flushed.
+	StopWait()
+	// StopNow shuts down the client immediately, cancelling any in-flight
+	// send and skipping the retry/backoff loop. Unlike Stop, it never blocks
+	// waiting on a downstream that is unreachable.
+	StopNow()
+	// ApplyConfig re-targets the client at newCfg without dropping anything
+	// already buffered. If newCfg only changes compatible parameters (e.g.
+	// URL, tenant, headers, timeouts, batching), the underlying promtail
+	// client is swapped atomically. If it changes a field the client cannot
+	// adopt in place (e.g. buffer type), ApplyConfig returns an error and the
+	// caller must recreate the client instead.
+	ApplyConfig(newCfg *config.Config) error
+}
+
+// RetryableError is implemented by errors that indicate the caller should
+// retry the entry after Delay rather than treat it as a permanent failure,
+// e.g. client.RateLimitedError while a tenant is backing off.
+type RetryableError interface {
+	error
+	Delay() time.Duration
+}
+
+// SyncHandler is implemented by a LokiClient that can push a single entry
+// synchronously and report whether it actually reached the downstream,
+// rather than merely queuing it for a later asynchronous flush like Handle
+// does. Callers that need a real delivery acknowledgment before advancing
+// past an entry - e.g. the WAL reader deciding when it is safe to
+// checkpoint - should use this instead of Handle when a client implements
+// it.
+type SyncHandler interface {
+	HandleSync(ls model.LabelSet, t time.Time, s string) error
+}